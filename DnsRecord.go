@@ -1,19 +1,33 @@
 package main
 
+import "github.com/cloudflare/cloudflare-go"
+
 type DnsRecord struct {
 	Id      string `json:"id"`
 	ZoneId  string `json:"zone_id"`
 	Type    string `json:"type"`
 	Name    string `json:"name"`
 	Content string `json:"content"`
+	Ttl     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
 }
 
-func CreateDnsRecordFrom(entry DnsRecordResponseEntry) *DnsRecord {
+func CreateDnsRecordFrom(entry cloudflare.DNSRecord) *DnsRecord {
 	return &DnsRecord{
-		Id:      entry.Id,
-		ZoneId:  entry.ZoneId,
+		Id:      entry.ID,
+		ZoneId:  entry.ZoneID,
 		Type:    entry.Type,
 		Name:    entry.Name,
 		Content: entry.Content,
+		Ttl:     entry.TTL,
+		Proxied: boolValue(entry.Proxied),
 	}
 }
+
+func boolValue(b *bool) bool {
+	if b == nil {
+		return false
+	}
+
+	return *b
+}
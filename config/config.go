@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RecordSpec describes one DNS record cloudflare-dns-sync should keep in
+// sync: which name and record type to watch, and the TTL/Proxied/Zone to
+// use when the record is created or updated.
+type RecordSpec struct {
+	Name    string `yaml:"name" json:"name"`
+	Type    string `yaml:"type" json:"type"`
+	Ttl     int    `yaml:"ttl" json:"ttl"`
+	Proxied bool   `yaml:"proxied" json:"proxied"`
+	Zone    string `yaml:"zone" json:"zone"`
+}
+
+type file struct {
+	Domains []RecordSpec `yaml:"domains" json:"domains"`
+}
+
+// Load reads a YAML or JSON config file (selected by its extension) into a
+// list of RecordSpecs, filling in Type and Ttl for entries that omit them.
+func Load(path string, defaultTtl int) ([]RecordSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed file
+
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &parsed)
+	} else {
+		err = yaml.Unmarshal(data, &parsed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range parsed.Domains {
+		applyDefaults(&parsed.Domains[i], defaultTtl)
+	}
+
+	return parsed.Domains, nil
+}
+
+// FromNames expands the legacy comma-separated -names shorthand into
+// RecordSpecs for both A and AAAA, using the given defaults for every name.
+func FromNames(namesCsv string, defaultTtl int, defaultProxied bool) []RecordSpec {
+	var specs []RecordSpec
+
+	for _, name := range strings.Split(namesCsv, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		specs = append(specs,
+			RecordSpec{Name: name, Type: "A", Ttl: defaultTtl, Proxied: defaultProxied},
+			RecordSpec{Name: name, Type: "AAAA", Ttl: defaultTtl, Proxied: defaultProxied},
+		)
+	}
+
+	return specs
+}
+
+func applyDefaults(spec *RecordSpec, defaultTtl int) {
+	if spec.Type == "" {
+		spec.Type = "A"
+	}
+
+	if spec.Ttl == 0 {
+		spec.Ttl = defaultTtl
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFromNames(t *testing.T) {
+	got := FromNames("home.example.com, vpn.other.org", 300, true)
+
+	want := []RecordSpec{
+		{Name: "home.example.com", Type: "A", Ttl: 300, Proxied: true},
+		{Name: "home.example.com", Type: "AAAA", Ttl: 300, Proxied: true},
+		{Name: "vpn.other.org", Type: "A", Ttl: 300, Proxied: true},
+		{Name: "vpn.other.org", Type: "AAAA", Ttl: 300, Proxied: true},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FromNames() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFromNamesSkipsBlankEntries(t *testing.T) {
+	got := FromNames(" home.example.com, ,", 1, false)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 specs for a single name, got %d: %+v", len(got), got)
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := writeTempFile(t, "domains.yaml", `
+domains:
+  - name: host1.example.com
+    type: AAAA
+  - name: host2.example.com
+    type: A
+    proxied: true
+  - name: host3.example.com
+    type: A
+    ttl: 300
+`)
+
+	specs, err := Load(path, 1)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := []RecordSpec{
+		{Name: "host1.example.com", Type: "AAAA", Ttl: 1},
+		{Name: "host2.example.com", Type: "A", Ttl: 1, Proxied: true},
+		{Name: "host3.example.com", Type: "A", Ttl: 300},
+	}
+
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("Load() = %+v, want %+v", specs, want)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeTempFile(t, "domains.json", `{
+		"domains": [
+			{"name": "host1.example.com", "zone": "example.com"}
+		]
+	}`)
+
+	specs, err := Load(path, 120)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := []RecordSpec{
+		{Name: "host1.example.com", Type: "A", Ttl: 120, Zone: "example.com"},
+	}
+
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("Load() = %+v, want %+v", specs, want)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml"), 1); err == nil {
+		t.Fatal("expected an error for a missing config file")
+	}
+}
+
+func writeTempFile(t *testing.T, name string, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+
+	return path
+}
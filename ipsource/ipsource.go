@@ -0,0 +1,127 @@
+package ipsource
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Provider discovers the machine's current public IPv4/IPv6 address.
+// Implementations should return an error rather than an empty string when
+// a family isn't available (e.g. an IPv4-only host asked for IPv6).
+type Provider interface {
+	Name() string
+	IPv4() (string, error)
+	IPv6() (string, error)
+}
+
+type httpProvider struct {
+	name  string
+	v4URL string
+	v6URL string
+}
+
+func (p httpProvider) Name() string { return p.name }
+
+func (p httpProvider) IPv4() (string, error) { return fetch(p.v4URL) }
+
+func (p httpProvider) IPv6() (string, error) { return fetch(p.v6URL) }
+
+// Icanhazip queries icanhazip.com.
+func Icanhazip() Provider {
+	return httpProvider{name: "icanhazip", v4URL: "https://ipv4.icanhazip.com/", v6URL: "https://ipv6.icanhazip.com/"}
+}
+
+// IfconfigCo queries ifconfig.co.
+func IfconfigCo() Provider {
+	return httpProvider{name: "ifconfig.co", v4URL: "https://v4.ifconfig.co/ip", v6URL: "https://v6.ifconfig.co/ip"}
+}
+
+// CloudflareTrace queries Cloudflare's own edge via the cdn-cgi/trace
+// endpoint, so it keeps working even when the other providers are down.
+type cloudflareTraceProvider struct{}
+
+func CloudflareTrace() Provider {
+	return cloudflareTraceProvider{}
+}
+
+func (cloudflareTraceProvider) Name() string { return "cloudflare-trace" }
+
+func (cloudflareTraceProvider) IPv4() (string, error) {
+	return traceIP("https://1.1.1.1/cdn-cgi/trace")
+}
+
+func (cloudflareTraceProvider) IPv6() (string, error) {
+	return traceIP("https://[2606:4700:4700::1111]/cdn-cgi/trace")
+}
+
+func traceIP(url string) (string, error) {
+	body, err := fetch(url)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		if ip, found := strings.CutPrefix(line, "ip="); found {
+			return ip, nil
+		}
+	}
+
+	return "", fmt.Errorf("no ip= line in response from %s", url)
+}
+
+func fetch(url string) (string, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fallbackProvider tries each provider in order and returns the first
+// successful result for the requested family.
+type fallbackProvider struct {
+	providers []Provider
+}
+
+// Fallback chains providers together, e.g. when one service is down or
+// doesn't support a family.
+func Fallback(providers ...Provider) Provider {
+	return fallbackProvider{providers: providers}
+}
+
+func (f fallbackProvider) Name() string { return "fallback" }
+
+func (f fallbackProvider) IPv4() (string, error) {
+	return f.first(Provider.IPv4)
+}
+
+func (f fallbackProvider) IPv6() (string, error) {
+	return f.first(Provider.IPv6)
+}
+
+func (f fallbackProvider) first(get func(Provider) (string, error)) (string, error) {
+	lastErr := fmt.Errorf("no ip providers configured")
+
+	for _, provider := range f.providers {
+		ip, err := get(provider)
+		if err == nil {
+			return ip, nil
+		}
+		lastErr = fmt.Errorf("%s: %w", provider.Name(), err)
+	}
+
+	return "", lastErr
+}
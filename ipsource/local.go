@@ -0,0 +1,62 @@
+package ipsource
+
+import (
+	"fmt"
+	"net"
+)
+
+// localInterfaceProvider reads a chosen network interface's own address
+// directly, for hosts that don't want to depend on an external IP-echo
+// service at all (e.g. an interface with a statically assigned public IP).
+type localInterfaceProvider struct {
+	interfaceName string
+}
+
+// LocalInterface reads the named interface's public (non-private) address.
+func LocalInterface(interfaceName string) Provider {
+	return localInterfaceProvider{interfaceName: interfaceName}
+}
+
+func (p localInterfaceProvider) Name() string { return "interface:" + p.interfaceName }
+
+func (p localInterfaceProvider) IPv4() (string, error) {
+	return p.address(func(ip net.IP) bool { return ip.To4() != nil })
+}
+
+func (p localInterfaceProvider) IPv6() (string, error) {
+	return p.address(func(ip net.IP) bool { return ip.To4() == nil })
+}
+
+func (p localInterfaceProvider) address(match func(net.IP) bool) (string, error) {
+	iface, err := net.InterfaceByName(p.interfaceName)
+	if err != nil {
+		return "", err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+
+	ip, ok := selectAddress(addrs, match)
+	if !ok {
+		return "", fmt.Errorf("no public address found on interface %s", p.interfaceName)
+	}
+
+	return ip, nil
+}
+
+// selectAddress returns the first address in addrs that is a public
+// (non-private, non-loopback, non-link-local) IP matching match.
+func selectAddress(addrs []net.Addr, match func(net.IP) bool) (string, bool) {
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() || ipNet.IP.IsPrivate() || !match(ipNet.IP) {
+			continue
+		}
+
+		return ipNet.IP.String(), true
+	}
+
+	return "", false
+}
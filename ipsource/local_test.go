@@ -0,0 +1,80 @@
+package ipsource
+
+import (
+	"net"
+	"testing"
+)
+
+func mustIPNet(t *testing.T, cidr string) *net.IPNet {
+	t.Helper()
+
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("ParseCIDR(%q) error = %v", cidr, err)
+	}
+	ipNet.IP = ip
+
+	return ipNet
+}
+
+func isIPv4(ip net.IP) bool { return ip.To4() != nil }
+
+func TestSelectAddressSkipsPrivateAndLoopback(t *testing.T) {
+	addrs := []net.Addr{
+		mustIPNet(t, "127.0.0.1/8"),
+		mustIPNet(t, "10.0.0.5/24"),
+		mustIPNet(t, "203.0.113.7/24"),
+	}
+
+	ip, ok := selectAddress(addrs, isIPv4)
+	if !ok {
+		t.Fatal("selectAddress() ok = false, want true")
+	}
+
+	if ip != "203.0.113.7" {
+		t.Fatalf("selectAddress() = %q, want %q", ip, "203.0.113.7")
+	}
+}
+
+func TestSelectAddressFiltersByFamily(t *testing.T) {
+	addrs := []net.Addr{
+		mustIPNet(t, "2001:db8::1/64"),
+		mustIPNet(t, "203.0.113.7/24"),
+	}
+
+	ip, ok := selectAddress(addrs, isIPv4)
+	if !ok {
+		t.Fatal("selectAddress() ok = false, want true")
+	}
+
+	if ip != "203.0.113.7" {
+		t.Fatalf("selectAddress() = %q, want %q", ip, "203.0.113.7")
+	}
+}
+
+func TestSelectAddressNoPublicMatch(t *testing.T) {
+	addrs := []net.Addr{
+		mustIPNet(t, "10.0.0.5/24"),
+		mustIPNet(t, "169.254.1.2/16"),
+	}
+
+	if _, ok := selectAddress(addrs, isIPv4); ok {
+		t.Fatal("selectAddress() ok = true, want false for only private/link-local addresses")
+	}
+}
+
+func TestLocalInterfaceName(t *testing.T) {
+	provider := LocalInterface("eth0")
+
+	if provider.Name() != "interface:eth0" {
+		t.Fatalf("Name() = %q, want %q", provider.Name(), "interface:eth0")
+	}
+}
+
+func TestLocalInterfaceUnknownInterface(t *testing.T) {
+	provider := LocalInterface("not-a-real-interface")
+
+	if _, err := provider.IPv4(); err == nil {
+		t.Fatal("expected an error for a nonexistent interface")
+	}
+}
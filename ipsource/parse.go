@@ -0,0 +1,53 @@
+package ipsource
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse builds a fallback chain from a comma-separated list of source names,
+// e.g. "icanhazip,ifconfig.co,cloudflare-trace" or "interface:eth0".
+func Parse(spec string) (Provider, error) {
+	var providers []Provider
+
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		provider, err := parseOne(name)
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, provider)
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no ip source configured")
+	}
+
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+
+	return Fallback(providers...), nil
+}
+
+func parseOne(name string) (Provider, error) {
+	if interfaceName, found := strings.CutPrefix(name, "interface:"); found {
+		return LocalInterface(interfaceName), nil
+	}
+
+	switch name {
+	case "icanhazip":
+		return Icanhazip(), nil
+	case "ifconfig.co":
+		return IfconfigCo(), nil
+	case "cloudflare-trace":
+		return CloudflareTrace(), nil
+	default:
+		return nil, fmt.Errorf("unknown ip source %q", name)
+	}
+}
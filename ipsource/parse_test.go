@@ -0,0 +1,84 @@
+package ipsource
+
+import "testing"
+
+func TestParseSingleSource(t *testing.T) {
+	provider, err := Parse("icanhazip")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if provider.Name() != "icanhazip" {
+		t.Fatalf("Name() = %q, want %q", provider.Name(), "icanhazip")
+	}
+}
+
+func TestParseBuildsFallbackChain(t *testing.T) {
+	provider, err := Parse("icanhazip, ifconfig.co,cloudflare-trace")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if provider.Name() != "fallback" {
+		t.Fatalf("Name() = %q, want a fallback provider for multiple sources", provider.Name())
+	}
+}
+
+func TestParseInterfaceSource(t *testing.T) {
+	provider, err := Parse("interface:eth0")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if provider.Name() != "interface:eth0" {
+		t.Fatalf("Name() = %q, want %q", provider.Name(), "interface:eth0")
+	}
+}
+
+func TestParseUnknownSource(t *testing.T) {
+	if _, err := Parse("not-a-real-source"); err == nil {
+		t.Fatal("expected an error for an unknown ip source")
+	}
+}
+
+func TestParseEmptySpec(t *testing.T) {
+	if _, err := Parse(" , "); err == nil {
+		t.Fatal("expected an error when no ip source is configured")
+	}
+}
+
+func TestFallbackUsesFirstSuccess(t *testing.T) {
+	provider := Fallback(stubProvider{err: errStub}, stubProvider{ip: "203.0.113.1"})
+
+	ip, err := provider.IPv4()
+	if err != nil {
+		t.Fatalf("IPv4() error = %v", err)
+	}
+
+	if ip != "203.0.113.1" {
+		t.Fatalf("IPv4() = %q, want %q", ip, "203.0.113.1")
+	}
+}
+
+func TestFallbackReturnsErrorWhenAllFail(t *testing.T) {
+	provider := Fallback(stubProvider{err: errStub}, stubProvider{err: errStub})
+
+	if _, err := provider.IPv4(); err == nil {
+		t.Fatal("expected an error when every provider fails")
+	}
+}
+
+var errStub = &stubError{"stub failure"}
+
+type stubError struct{ msg string }
+
+func (e *stubError) Error() string { return e.msg }
+
+type stubProvider struct {
+	ip  string
+	err error
+}
+
+func (p stubProvider) Name() string          { return "stub" }
+func (p stubProvider) IPv4() (string, error) { return p.ip, p.err }
+func (p stubProvider) IPv6() (string, error) { return p.ip, p.err }
@@ -1,238 +1,403 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+
+	"github.com/PetterKraabol/cloudflare-dns-sync/config"
+	"github.com/PetterKraabol/cloudflare-dns-sync/ipsource"
+	"github.com/PetterKraabol/cloudflare-dns-sync/metrics"
 )
 
 const (
-	A          string = "A"
-	AAAA              = "AAAA"
-	CLOUDFLARE        = "https://api.cloudflare.com/client/v4/zones/"
+	A    string = "A"
+	AAAA        = "AAAA"
 )
 
-type DnsRecordsResponse struct {
-	Result []DnsRecordResponseEntry `json:"result"`
-}
-
-type DnsRecordResponseEntry struct {
-	Id        string `json:"id"`
-	ZoneId    string `json:"zone_id"`
-	ZoneName  string `json:"zone_name"`
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	Content   string `json:"content"`
-	Proxiable bool   `json:"proxiable"`
-	Proxied   bool   `json:"proxied"`
-	Ttl       int    `json:"ttl"`
-	Locked    bool   `json:"locked"`
-	Meta      struct {
-		AutoAdded           bool   `json:"auto_added"`
-		ManagedByApps       bool   `json:"managed_by_apps"`
-		ManagedByArgoTunnel bool   `json:"managed_by_argo_tunnel"`
-		Source              string `json:"source"`
-	} `json:"meta"`
-	CreatedOn  time.Time `json:"created_on"`
-	ModifiedOn time.Time `json:"modified_on"`
-}
-
-type DnsRecord struct {
-	Id      string `json:"id"`
-	ZoneId  string `json:"zone_id"`
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
-}
-
-func CreateDnsRecordFrom(entry DnsRecordResponseEntry) *DnsRecord {
-	return &DnsRecord{
-		Id:      entry.Id,
-		ZoneId:  entry.ZoneId,
-		Type:    entry.Type,
-		Name:    entry.Name,
-		Content: entry.Content,
-	}
-}
-
 func main() {
-	zoneId := flag.String("zone-id", os.Getenv("CLOUDFLARE_ZONE_ID"), "Cloudflare Zone ID")
-	email := flag.String("email", os.Getenv("CLOUDFLARE_EMAIL"), "Cloudflare email address")
-	key := flag.String("auth-key", os.Getenv("CLOUDFLARE_AUTH_KEY"), "Cloudflare global API key")
-	dnsNamesRawInput := flag.String("names", os.Getenv("CLOUDFLARE_SYNC_NAMES"), "Comma-separated DNS names")
+	zoneId := flag.String("zone-id", os.Getenv("CLOUDFLARE_ZONE_ID"), "Cloudflare Zone ID (optional; auto-discovered per record when omitted, unless a record sets its own zone)")
+	email := flag.String("email", os.Getenv("CLOUDFLARE_EMAIL"), "Cloudflare email address (used with -auth-key)")
+	key := flag.String("auth-key", os.Getenv("CLOUDFLARE_AUTH_KEY"), "Cloudflare global API key (used with -email)")
+	apiToken := flag.String("api-token", os.Getenv("CLOUDFLARE_API_TOKEN"), "Cloudflare API token with Zone.DNS:Edit scope")
+	dnsNamesRawInput := flag.String("names", os.Getenv("CLOUDFLARE_SYNC_NAMES"), "Comma-separated DNS names (shorthand for -config; syncs both A and AAAA)")
+	configPath := flag.String("config", os.Getenv("CLOUDFLARE_SYNC_CONFIG"), "Path to a YAML or JSON config file listing records to sync")
+	ttl := flag.Int("ttl", 1, "Default TTL for records that don't set their own (1 = automatic)")
+	proxied := flag.Bool("proxied", false, "Default proxied setting for records created from -names")
+	ipSourceRaw := flag.String("ip-source", "icanhazip,ifconfig.co,cloudflare-trace", "Comma-separated IP source fallback chain (icanhazip, ifconfig.co, cloudflare-trace, interface:<name>)")
+	daemon := flag.Bool("daemon", false, "Run continuously on -interval instead of once")
+	interval := flag.Duration("interval", 5*time.Minute, "Poll interval in -daemon mode")
+	dryRun := flag.Bool("dry-run", false, "Log planned Cloudflare API calls without executing them")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	metricsAddr := flag.String("metrics-addr", "", "Address to expose Prometheus metrics on, e.g. :9101 (disabled when empty)")
 	flag.Parse()
 
-	if *zoneId == "" || *email == "" || *key == "" || *dnsNamesRawInput == "" {
-		log.Fatal("Missing arguments. Use -h for help")
+	if err := configureLogger(*logFormat); err != nil {
+		fatal("configure logger", err)
+	}
+
+	specs, err := loadRecordSpecs(*configPath, *dnsNamesRawInput, *ttl, *proxied)
+	if err != nil {
+		fatal("load record specs", err)
 	}
 
-	dnsNames := strings.Split(*dnsNamesRawInput, ",")
+	if len(specs) == 0 {
+		slog.Error("Missing arguments. Use -h for help")
+		os.Exit(1)
+	}
 
-	ipAddresses, err := getExternalIpAddresses()
+	api, err := newCloudflareApi(*apiToken, *email, *key)
 	if err != nil {
-		log.Fatal(err)
+		fatal("create cloudflare client", err)
 	}
 
-	// Get dns records
-	dnsRecordsResponses, err := getDnsRecords(*zoneId, *email, *key)
+	specsByZone, err := groupSpecsByZone(api, *zoneId, specs)
 	if err != nil {
-		log.Fatal(err)
+		fatal("resolve zones", err)
 	}
 
-	for _, dnsRecordResponse := range dnsRecordsResponses {
-		dnsRecord := CreateDnsRecordFrom(dnsRecordResponse)
+	ipProvider, err := ipsource.Parse(*ipSourceRaw)
+	if err != nil {
+		fatal("parse ip source", err)
+	}
 
-		// Filter out names not to update
-		if !contains(dnsNames, dnsRecord.Name) {
-			continue
-		}
+	if *metricsAddr != "" {
+		metrics.Serve(*metricsAddr)
+	}
 
-		// DNS content is already the external ip address
-		if currentContent, ok := ipAddresses[dnsRecord.Type]; !ok || currentContent == dnsRecord.Content {
-			continue
+	ctx := context.Background()
+
+	sync := func(ipAddresses map[string]string) error {
+		recordCurrentIpMetrics(ipAddresses)
+
+		for zoneId, zoneSpecs := range specsByZone {
+			if err := syncZone(ctx, api, zoneId, zoneSpecs, ipAddresses, *dryRun); err != nil {
+				return err
+			}
 		}
 
-		fmt.Println(dnsRecord.Type, dnsRecord.Name, dnsRecord.Content, "->", ipAddresses[dnsRecord.Type])
+		metrics.LastSuccessTimestamp.SetToCurrentTime()
 
-		dnsRecord.Content = ipAddresses[dnsRecord.Type]
+		return nil
+	}
+
+	if !*daemon {
+		ipAddresses, err := getExternalIpAddresses(ipProvider)
+		if err != nil {
+			fatal("determine external ip", err)
+		}
 
-		if err := updateDnsRecord(*dnsRecord, *email, *key); err != nil {
-			log.Fatal(err)
+		if err := sync(ipAddresses); err != nil {
+			metrics.ErrorsTotal.Inc()
+			fatal("sync", err)
 		}
+
+		return
 	}
 
-}
+	if *interval <= 0 {
+		fatal("validate interval", fmt.Errorf("-interval must be positive, got %s", interval))
+	}
 
-func updateDnsRecord(record DnsRecord, email string, key string) error {
-	data, err := json.Marshal(map[string]string{
-		"content": record.Content,
-	})
+	runDaemon(ipProvider, *interval, sync)
+}
 
-	client := &http.Client{}
+func configureLogger(format string) error {
+	var handler slog.Handler
 
-	request, err := http.NewRequest(http.MethodPatch, CLOUDFLARE+record.ZoneId+"/dns_records/"+record.Id, bytes.NewBuffer(data))
-	if err != nil {
-		return err
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	default:
+		return fmt.Errorf("unknown log format %q, want text or json", format)
 	}
 
-	request.Header = http.Header{
-		"x-auth-email": []string{email},
-		"x-auth-key":   []string{key},
-		"Content-Type": []string{"application/json"},
-	}
+	slog.SetDefault(slog.New(handler))
 
-	response, err := client.Do(request)
-	if err != nil {
-		return err
+	return nil
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func recordCurrentIpMetrics(ipAddresses map[string]string) {
+	families := map[string]string{A: "v4", AAAA: "v6"}
+
+	for recordType, family := range families {
+		if ip, ok := ipAddresses[recordType]; ok {
+			metrics.SetCurrentIP(family, ip)
+		}
 	}
+}
+
+// runDaemon polls ipProvider on interval and only invokes sync when the
+// observed IPs changed since the last successful run, so the Cloudflare API
+// isn't called on ticks where nothing changed. A failed sync is retried on
+// the next tick.
+func runDaemon(ipProvider ipsource.Provider, interval time.Duration, sync func(ipAddresses map[string]string) error) {
+	var lastIpAddresses map[string]string
 
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ipAddresses, err := getExternalIpAddresses(ipProvider)
 		if err != nil {
-			log.Fatal(err)
+			slog.Error("determine external ip", "error", err)
+		} else if !ipAddressesEqual(lastIpAddresses, ipAddresses) {
+			if err := sync(ipAddresses); err != nil {
+				metrics.ErrorsTotal.Inc()
+				slog.Error("sync", "error", err)
+			} else {
+				lastIpAddresses = ipAddresses
+			}
 		}
-	}(response.Body)
 
-	bodyBytes, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return err
+		<-ticker.C
 	}
+}
 
-	if response.StatusCode != http.StatusOK {
-		return errors.New("Could not update DNS record " + string(data) + "\n" +
-			"Response status: " + response.Status + "\n" +
-			string(bodyBytes))
+func ipAddressesEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
 	}
 
-	return nil
+	for recordType, ip := range a {
+		if b[recordType] != ip {
+			return false
+		}
+	}
+
+	return true
 }
 
-func getExternalIpAddresses() (map[string]string, error) {
-	ipv4, err := getExternalIpAddress("ipv4")
-	if err != nil {
-		return nil, err
+// loadRecordSpecs reads the record list from -config when given, otherwise
+// expands the legacy -names CSV shorthand using the -ttl/-proxied defaults.
+func loadRecordSpecs(configPath string, namesCsv string, ttl int, proxied bool) ([]config.RecordSpec, error) {
+	if configPath != "" {
+		return config.Load(configPath, ttl)
 	}
 
-	ipv6, err := getExternalIpAddress("ipv6")
-	if err != nil {
-		return nil, err
+	return config.FromNames(namesCsv, ttl, proxied), nil
+}
+
+// groupSpecsByZone resolves each record to its Cloudflare zone id, so that
+// records spanning multiple zones can be synced from a single invocation. A
+// record's own Zone wins, then the global -zone-id, then auto-discovery.
+func groupSpecsByZone(api *cloudflare.API, zoneId string, specs []config.RecordSpec) (map[string][]config.RecordSpec, error) {
+	specsByZone := make(map[string][]config.RecordSpec)
+
+	// Cache resolved zone ids by record name so specs for the same name (e.g. its
+	// A and AAAA) only resolve it once; different names under one apex each resolve it
+	resolvedZoneIds := make(map[string]string)
+
+	for _, spec := range specs {
+		zone := zoneId
+		if spec.Zone != "" {
+			zone = spec.Zone
+		}
+
+		if zone == "" {
+			resolved, ok := resolvedZoneIds[spec.Name]
+			if !ok {
+				var err error
+				resolved, err = resolveZoneId(api, spec.Name)
+				if err != nil {
+					return nil, err
+				}
+				resolvedZoneIds[spec.Name] = resolved
+			}
+			zone = resolved
+		}
+
+		specsByZone[zone] = append(specsByZone[zone], spec)
 	}
 
-	return map[string]string{
-		A:    ipv4,
-		AAAA: ipv6,
-	}, nil
+	return specsByZone, nil
 }
 
-func getExternalIpAddress(version string) (string, error) {
-	response, err := http.Get("https://" + version + ".icanhazip.com/")
-	if err != nil {
-		return "", err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
+// resolveZoneId finds the zone id owning name by trying progressively shorter
+// suffixes of its labels until Cloudflare recognizes one as a zone, e.g. for
+// "home.example.com" it tries "home.example.com" then "example.com".
+func resolveZoneId(api *cloudflare.API, name string) (string, error) {
+	labels := strings.Split(name, ".")
 
-		}
-	}(response.Body)
+	for i := 0; i < len(labels)-1; i++ {
+		candidate := strings.Join(labels[i:], ".")
 
-	if response.StatusCode == http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			log.Fatal(err)
+		zoneId, err := api.ZoneIDByName(candidate)
+		if err == nil {
+			return zoneId, nil
 		}
-		return strings.TrimSpace(string(bodyBytes)), nil
 	}
 
-	return "", err
+	return "", fmt.Errorf("could not resolve zone id for %s", name)
 }
 
-func getDnsRecords(zoneId string, email string, key string) ([]DnsRecordResponseEntry, error) {
-	client := &http.Client{}
-	request, err := http.NewRequest(http.MethodGet, CLOUDFLARE+zoneId+"/dns_records", nil)
+func syncZone(ctx context.Context, api *cloudflare.API, zoneId string, specs []config.RecordSpec, ipAddresses map[string]string, dryRun bool) error {
+	// Get dns records
+	dnsRecordEntries, err := getDnsRecords(ctx, api, zoneId)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	request.Header = http.Header{
-		"x-auth-email": []string{email},
-		"x-auth-key":   []string{key},
-		"Content-Type": []string{"application/json"},
+	// Track which name/type pairs already exist so we know what's left to create
+	seen := make(map[string]map[string]bool)
+
+	for _, entry := range dnsRecordEntries {
+		dnsRecord := CreateDnsRecordFrom(entry)
+
+		// Filter out records not in scope for this run
+		spec, ok := findSpec(specs, dnsRecord.Name, dnsRecord.Type)
+		if !ok {
+			continue
+		}
+
+		if seen[dnsRecord.Name] == nil {
+			seen[dnsRecord.Name] = make(map[string]bool)
+		}
+		seen[dnsRecord.Name][dnsRecord.Type] = true
+
+		// Apply the spec's Ttl/Proxied to the update below; a record whose content
+		// already matches is left as it is, even if its Ttl/Proxied differ from the spec
+		dnsRecord.Ttl = spec.Ttl
+		dnsRecord.Proxied = spec.Proxied
+
+		// DNS content is already the external ip address
+		if currentContent, ok := ipAddresses[dnsRecord.Type]; !ok || currentContent == dnsRecord.Content {
+			continue
+		}
+
+		slog.Info("updating record", "type", dnsRecord.Type, "name", dnsRecord.Name, "from", dnsRecord.Content, "to", ipAddresses[dnsRecord.Type], "dry_run", dryRun)
+
+		dnsRecord.Content = ipAddresses[dnsRecord.Type]
+
+		if dryRun {
+			continue
+		}
+
+		if err := updateDnsRecord(ctx, api, *dnsRecord); err != nil {
+			return err
+		}
+
+		metrics.UpdatesTotal.Inc()
 	}
 
-	response, err := client.Do(request)
+	for _, spec := range specs {
+		if seen[spec.Name][spec.Type] {
+			continue
+		}
 
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Fatal(err)
+		content, ok := ipAddresses[spec.Type]
+		if !ok {
+			continue
 		}
-	}(response.Body)
 
-	body, err := ioutil.ReadAll(response.Body)
-	var dnsRecordsResponse DnsRecordsResponse
-	if err := json.Unmarshal(body, &dnsRecordsResponse); err != nil {
-		return nil, err
+		slog.Info("creating record", "type", spec.Type, "name", spec.Name, "content", content, "ttl", spec.Ttl, "proxied", spec.Proxied, "dry_run", dryRun)
+
+		if dryRun {
+			continue
+		}
+
+		if err := createDnsRecord(ctx, api, zoneId, spec.Name, spec.Type, content, spec.Ttl, spec.Proxied); err != nil {
+			return err
+		}
+
+		metrics.UpdatesTotal.Inc()
 	}
 
-	return dnsRecordsResponse.Result, nil
+	return nil
 }
 
-func contains(list []string, value string) bool {
-	for _, item := range list {
-		if item == value {
-			return true
+// findSpec returns the RecordSpec matching name/recordType, if any is in scope for this run.
+func findSpec(specs []config.RecordSpec, name string, recordType string) (config.RecordSpec, bool) {
+	for _, spec := range specs {
+		if spec.Name == name && spec.Type == recordType {
+			return spec, true
 		}
 	}
 
-	return false
+	return config.RecordSpec{}, false
+}
+
+// newCloudflareApi picks the auth mode based on which credentials were supplied,
+// preferring a scoped API Token over the legacy global key + email pair.
+func newCloudflareApi(apiToken string, email string, key string) (*cloudflare.API, error) {
+	if apiToken != "" {
+		return cloudflare.NewWithAPIToken(apiToken)
+	}
+
+	if email == "" || key == "" {
+		return nil, errors.New("missing credentials: provide -api-token, or both -email and -auth-key")
+	}
+
+	return cloudflare.New(key, email)
+}
+
+func updateDnsRecord(ctx context.Context, api *cloudflare.API, record DnsRecord) error {
+	// Send the record's TTL/Proxied along with the content, so the PATCH sets
+	// them to these values rather than leaving Cloudflare's current ones
+	proxied := record.Proxied
+
+	// Name/Type must be set too, otherwise cloudflare-go does an extra internal
+	// GET to fill them in before issuing the update
+	return api.UpdateDNSRecord(ctx, record.ZoneId, record.Id, cloudflare.DNSRecord{
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Content,
+		TTL:     record.Ttl,
+		Proxied: &proxied,
+	})
+}
+
+func createDnsRecord(ctx context.Context, api *cloudflare.API, zoneId string, name string, recordType string, content string, ttl int, proxied bool) error {
+	_, err := api.CreateDNSRecord(ctx, zoneId, cloudflare.DNSRecord{
+		Type:    recordType,
+		Name:    name,
+		Content: content,
+		TTL:     ttl,
+		Proxied: &proxied,
+	})
+
+	return err
+}
+
+// getExternalIpAddresses looks up whichever families ipProvider can supply.
+// A family that errors (e.g. no IPv6 on an IPv4-only host) is simply left
+// out rather than failing the whole lookup.
+func getExternalIpAddresses(ipProvider ipsource.Provider) (map[string]string, error) {
+	ipAddresses := make(map[string]string)
+
+	if ipv4, err := ipProvider.IPv4(); err == nil {
+		ipAddresses[A] = ipv4
+	} else {
+		slog.Warn("ipv4 lookup failed", "error", err)
+	}
+
+	if ipv6, err := ipProvider.IPv6(); err == nil {
+		ipAddresses[AAAA] = ipv6
+	} else {
+		slog.Warn("ipv6 lookup failed", "error", err)
+	}
+
+	if len(ipAddresses) == 0 {
+		return nil, errors.New("could not determine any external ip address")
+	}
+
+	return ipAddresses, nil
+}
+
+func getDnsRecords(ctx context.Context, api *cloudflare.API, zoneId string) ([]cloudflare.DNSRecord, error) {
+	return api.DNSRecords(ctx, zoneId, cloudflare.DNSRecord{})
 }
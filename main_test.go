@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+
+	"github.com/PetterKraabol/cloudflare-dns-sync/config"
+)
+
+// fakeCloudflare is a minimal stand-in for the Cloudflare API, serving just
+// enough of the v4 REST surface for zone/DNS record tests to drive real
+// cloudflare-go client calls against an httptest server instead of the network.
+type fakeCloudflare struct {
+	mu sync.Mutex
+
+	zones        map[string]string // name -> zone id
+	records      map[string][]cloudflare.DNSRecord
+	zoneLookups  int32
+	updates      []cloudflare.DNSRecord
+	creates      []cloudflare.DNSRecord
+	nextRecordID int
+}
+
+func newFakeCloudflare() *fakeCloudflare {
+	return &fakeCloudflare{
+		zones:   make(map[string]string),
+		records: make(map[string][]cloudflare.DNSRecord),
+	}
+}
+
+func (f *fakeCloudflare) server() *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/zones", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&f.zoneLookups, 1)
+
+		name := r.URL.Query().Get("name")
+
+		f.mu.Lock()
+		id, ok := f.zones[name]
+		f.mu.Unlock()
+
+		var result []cloudflare.Zone
+		if ok {
+			result = []cloudflare.Zone{{ID: id, Name: name}}
+		}
+
+		writeJSON(w, cloudflare.ZonesResponse{
+			Response: cloudflare.Response{Success: true},
+			Result:   result,
+		})
+	})
+
+	mux.HandleFunc("/zones/", func(w http.ResponseWriter, r *http.Request) {
+		// Matches both /zones/{id}/dns_records and /zones/{id}/dns_records/{recordId}
+		zoneID, recordID, ok := parseZoneAndRecord(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet:
+			f.mu.Lock()
+			records := append([]cloudflare.DNSRecord(nil), f.records[zoneID]...)
+			f.mu.Unlock()
+
+			writeJSON(w, cloudflare.DNSListResponse{
+				Response: cloudflare.Response{Success: true},
+				Result:   records,
+			})
+
+		case r.Method == http.MethodPost:
+			var rr cloudflare.DNSRecord
+			_ = json.NewDecoder(r.Body).Decode(&rr)
+
+			f.mu.Lock()
+			f.nextRecordID++
+			rr.ID = fmt.Sprintf("record-%d", f.nextRecordID)
+			rr.ZoneID = zoneID
+			f.records[zoneID] = append(f.records[zoneID], rr)
+			f.creates = append(f.creates, rr)
+			f.mu.Unlock()
+
+			writeJSON(w, cloudflare.DNSRecordResponse{
+				Response: cloudflare.Response{Success: true},
+				Result:   rr,
+			})
+
+		case r.Method == http.MethodPatch:
+			var rr cloudflare.DNSRecord
+			_ = json.NewDecoder(r.Body).Decode(&rr)
+
+			f.mu.Lock()
+			f.updates = append(f.updates, rr)
+			for i, existing := range f.records[zoneID] {
+				if existing.ID == recordID {
+					f.records[zoneID][i].Content = rr.Content
+					f.records[zoneID][i].TTL = rr.TTL
+					f.records[zoneID][i].Proxied = rr.Proxied
+				}
+			}
+			f.mu.Unlock()
+
+			writeJSON(w, cloudflare.DNSRecordResponse{
+				Response: cloudflare.Response{Success: true},
+				Result:   rr,
+			})
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// parseZoneAndRecord splits "/zones/{zoneId}/dns_records[/{recordId}]" paths
+// into their zone id and, if present, record id.
+func parseZoneAndRecord(path string) (zoneID string, recordID string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) < 3 || parts[0] != "zones" || parts[2] != "dns_records" {
+		return "", "", false
+	}
+
+	zoneID = parts[1]
+	if len(parts) >= 4 {
+		recordID = parts[3]
+	}
+
+	return zoneID, recordID, true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestAPI(t *testing.T, baseURL string) *cloudflare.API {
+	t.Helper()
+
+	api, err := cloudflare.NewWithAPIToken("test-token")
+	if err != nil {
+		t.Fatalf("NewWithAPIToken() error = %v", err)
+	}
+	api.BaseURL = baseURL
+
+	return api
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestSyncZoneCreatesMissingRecords(t *testing.T) {
+	fake := newFakeCloudflare()
+	server := fake.server()
+	defer server.Close()
+
+	api := newTestAPI(t, server.URL)
+
+	specs := []config.RecordSpec{{Name: "home.example.com", Type: "A", Ttl: 300, Proxied: true}}
+	ipAddresses := map[string]string{A: "203.0.113.9"}
+
+	if err := syncZone(context.Background(), api, "zone1", specs, ipAddresses, false); err != nil {
+		t.Fatalf("syncZone() error = %v", err)
+	}
+
+	if len(fake.creates) != 1 {
+		t.Fatalf("len(creates) = %d, want 1", len(fake.creates))
+	}
+
+	created := fake.creates[0]
+	if created.Name != "home.example.com" || created.Content != "203.0.113.9" || created.TTL != 300 {
+		t.Fatalf("created record = %+v, want name/content/ttl from spec", created)
+	}
+}
+
+func TestSyncZoneUpdatesChangedContentAndAppliesSpecOverrides(t *testing.T) {
+	fake := newFakeCloudflare()
+	fake.records["zone1"] = []cloudflare.DNSRecord{
+		{ID: "record-1", ZoneID: "zone1", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 1, Proxied: boolPtr(false)},
+	}
+	server := fake.server()
+	defer server.Close()
+
+	api := newTestAPI(t, server.URL)
+
+	// The spec's Ttl/Proxied differ from the existing record's, simulating a
+	// config change for a record that already exists in Cloudflare.
+	specs := []config.RecordSpec{{Name: "home.example.com", Type: "A", Ttl: 600, Proxied: true}}
+	ipAddresses := map[string]string{A: "203.0.113.9"}
+
+	if err := syncZone(context.Background(), api, "zone1", specs, ipAddresses, false); err != nil {
+		t.Fatalf("syncZone() error = %v", err)
+	}
+
+	if len(fake.updates) != 1 {
+		t.Fatalf("len(updates) = %d, want 1", len(fake.updates))
+	}
+
+	update := fake.updates[0]
+	if update.Name != "home.example.com" || update.Type != "A" {
+		t.Fatalf("update Name/Type = %q/%q, want both set so cloudflare-go skips its extra GET", update.Name, update.Type)
+	}
+	if update.Content != "203.0.113.9" {
+		t.Fatalf("update Content = %q, want new ip", update.Content)
+	}
+	if update.TTL != 600 {
+		t.Fatalf("update TTL = %d, want the spec's 600, not the existing record's 1", update.TTL)
+	}
+	if update.Proxied == nil || !*update.Proxied {
+		t.Fatalf("update Proxied = %v, want the spec's true, not the existing record's false", update.Proxied)
+	}
+
+	if len(fake.creates) != 0 {
+		t.Fatalf("len(creates) = %d, want 0 for a record that already exists", len(fake.creates))
+	}
+}
+
+func TestSyncZoneSkipsRecordsNotInSpec(t *testing.T) {
+	fake := newFakeCloudflare()
+	fake.records["zone1"] = []cloudflare.DNSRecord{
+		{ID: "record-1", ZoneID: "zone1", Type: "A", Name: "other.example.com", Content: "198.51.100.1", TTL: 1, Proxied: boolPtr(false)},
+	}
+	server := fake.server()
+	defer server.Close()
+
+	api := newTestAPI(t, server.URL)
+
+	specs := []config.RecordSpec{{Name: "home.example.com", Type: "A", Ttl: 1, Proxied: false}}
+	ipAddresses := map[string]string{A: "203.0.113.9"}
+
+	if err := syncZone(context.Background(), api, "zone1", specs, ipAddresses, false); err != nil {
+		t.Fatalf("syncZone() error = %v", err)
+	}
+
+	if len(fake.updates) != 0 {
+		t.Fatalf("len(updates) = %d, want 0 for a record out of scope", len(fake.updates))
+	}
+}
+
+func TestSyncZoneDryRunMakesNoChanges(t *testing.T) {
+	fake := newFakeCloudflare()
+	fake.records["zone1"] = []cloudflare.DNSRecord{
+		{ID: "record-1", ZoneID: "zone1", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 1, Proxied: boolPtr(false)},
+	}
+	server := fake.server()
+	defer server.Close()
+
+	api := newTestAPI(t, server.URL)
+
+	specs := []config.RecordSpec{
+		{Name: "home.example.com", Type: "A", Ttl: 600, Proxied: true},
+		{Name: "new.example.com", Type: "A", Ttl: 1, Proxied: false},
+	}
+	ipAddresses := map[string]string{A: "203.0.113.9"}
+
+	if err := syncZone(context.Background(), api, "zone1", specs, ipAddresses, true); err != nil {
+		t.Fatalf("syncZone() error = %v", err)
+	}
+
+	if len(fake.updates) != 0 || len(fake.creates) != 0 {
+		t.Fatalf("dry-run made API calls: updates=%d creates=%d, want 0/0", len(fake.updates), len(fake.creates))
+	}
+}
+
+func TestGroupSpecsByZoneMemoizesResolution(t *testing.T) {
+	fake := newFakeCloudflare()
+	fake.zones["example.com"] = "zone-example"
+	server := fake.server()
+	defer server.Close()
+
+	api := newTestAPI(t, server.URL)
+
+	specs := []config.RecordSpec{
+		{Name: "example.com", Type: "A"},
+		{Name: "example.com", Type: "AAAA"},
+	}
+
+	specsByZone, err := groupSpecsByZone(api, "", specs)
+	if err != nil {
+		t.Fatalf("groupSpecsByZone() error = %v", err)
+	}
+
+	if len(specsByZone["zone-example"]) != 2 {
+		t.Fatalf("specsByZone[zone-example] = %+v, want 2 specs", specsByZone["zone-example"])
+	}
+
+	if got := atomic.LoadInt32(&fake.zoneLookups); got != 1 {
+		t.Fatalf("zone lookups = %d, want 1 for two specs sharing the same name", got)
+	}
+}
+
+func TestGroupSpecsByZonePrefersExplicitZone(t *testing.T) {
+	api := newTestAPI(t, "http://unused.invalid")
+
+	specs := []config.RecordSpec{{Name: "home.example.com", Type: "A", Zone: "explicit-zone"}}
+
+	specsByZone, err := groupSpecsByZone(api, "", specs)
+	if err != nil {
+		t.Fatalf("groupSpecsByZone() error = %v", err)
+	}
+
+	if len(specsByZone["explicit-zone"]) != 1 {
+		t.Fatalf("specsByZone = %+v, want the spec under its explicit zone without any lookup", specsByZone)
+	}
+}
+
+func TestResolveZoneIdWalksSuffixes(t *testing.T) {
+	fake := newFakeCloudflare()
+	fake.zones["example.com"] = "zone-example"
+	server := fake.server()
+	defer server.Close()
+
+	api := newTestAPI(t, server.URL)
+
+	zoneID, err := resolveZoneId(api, "home.example.com")
+	if err != nil {
+		t.Fatalf("resolveZoneId() error = %v", err)
+	}
+
+	if zoneID != "zone-example" {
+		t.Fatalf("resolveZoneId() = %q, want %q", zoneID, "zone-example")
+	}
+}
+
+func TestResolveZoneIdNotFound(t *testing.T) {
+	fake := newFakeCloudflare()
+	server := fake.server()
+	defer server.Close()
+
+	api := newTestAPI(t, server.URL)
+
+	if _, err := resolveZoneId(api, "home.example.com"); err == nil {
+		t.Fatal("expected an error when no suffix resolves to a zone")
+	}
+}
+
+func TestIpAddressesEqual(t *testing.T) {
+	a := map[string]string{"A": "1.2.3.4", "AAAA": "::1"}
+	b := map[string]string{"A": "1.2.3.4", "AAAA": "::1"}
+
+	if !ipAddressesEqual(a, b) {
+		t.Fatal("ipAddressesEqual() = false, want true for identical maps")
+	}
+
+	if ipAddressesEqual(a, map[string]string{"A": "1.2.3.4"}) {
+		t.Fatal("ipAddressesEqual() = true, want false for differing lengths")
+	}
+
+	if ipAddressesEqual(a, map[string]string{"A": "1.2.3.4", "AAAA": "::2"}) {
+		t.Fatal("ipAddressesEqual() = true, want false for a differing value")
+	}
+}
+
+type sequenceProvider struct {
+	mu  sync.Mutex
+	ips []string
+	n   int
+}
+
+func (p *sequenceProvider) Name() string { return "sequence" }
+
+func (p *sequenceProvider) IPv4() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ip := p.ips[p.n]
+	if p.n < len(p.ips)-1 {
+		p.n++
+	}
+
+	return ip, nil
+}
+
+func (p *sequenceProvider) IPv6() (string, error) { return "", fmt.Errorf("no ipv6") }
+
+func TestRunDaemonOnlySyncsOnChange(t *testing.T) {
+	provider := &sequenceProvider{ips: []string{"203.0.113.1", "203.0.113.1", "203.0.113.2"}}
+
+	var syncs int32
+	syncCalls := make(chan map[string]string, 10)
+
+	go runDaemon(provider, 5*time.Millisecond, func(ipAddresses map[string]string) error {
+		atomic.AddInt32(&syncs, 1)
+		syncCalls <- ipAddresses
+		return nil
+	})
+
+	first := <-syncCalls
+	if first["A"] != "203.0.113.1" {
+		t.Fatalf("first sync ip = %q, want %q", first["A"], "203.0.113.1")
+	}
+
+	second := <-syncCalls
+	if second["A"] != "203.0.113.2" {
+		t.Fatalf("second sync ip = %q, want %q (unchanged ticks shouldn't resync)", second["A"], "203.0.113.2")
+	}
+
+	select {
+	case unexpected := <-syncCalls:
+		t.Fatalf("unexpected extra sync call with %+v", unexpected)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	UpdatesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_sync_updates_total",
+		Help: "Number of DNS records created or updated",
+	})
+
+	ErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cloudflare_sync_errors_total",
+		Help: "Number of sync runs that failed",
+	})
+
+	LastSuccessTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "cloudflare_sync_last_success_timestamp",
+		Help: "Unix timestamp of the last successful sync",
+	})
+
+	CurrentIP = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloudflare_sync_current_ip",
+		Help: "Last observed external IP per family, set to 1 with the address as a label",
+	}, []string{"family", "ip"})
+
+	currentIPMu       sync.Mutex
+	currentIPByFamily = make(map[string]string)
+)
+
+// SetCurrentIP records ip as the current address for family, removing the
+// previous address's time series so a rotating IP doesn't leave stale
+// "1"-valued series behind on a long-running daemon.
+func SetCurrentIP(family string, ip string) {
+	currentIPMu.Lock()
+	defer currentIPMu.Unlock()
+
+	if previous, ok := currentIPByFamily[family]; ok && previous != ip {
+		CurrentIP.DeleteLabelValues(family, previous)
+	}
+
+	CurrentIP.WithLabelValues(family, ip).Set(1)
+	currentIPByFamily[family] = ip
+}
+
+// Serve exposes the default registry on addr's /metrics endpoint until the
+// process exits. ListenAndServe errors are logged rather than fatal, since
+// metrics are an optional add-on and shouldn't take the syncer down.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("metrics server stopped", "error", err)
+		}
+	}()
+}